@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/tun"
+)
+
+// physicalInterfaceBind returns a dialer Control function that binds outbound DNS upstream
+// sockets to the host's default-route interface, via IP_BOUND_IF/IPV6_BOUND_IF, so they're never
+// captured by our own TUN device's routes. It returns nil (no binding) if the default interface
+// can't be determined, so a lookup failure degrades to the old routing-table behavior instead of
+// breaking DNS outright.
+func physicalInterfaceBind(c context.Context) func(network, address string, rc syscall.RawConn) error {
+	ifIndex, err := defaultRouteInterfaceIndex()
+	if err != nil {
+		dlog.Errorf(c, "unable to determine the physical default-route interface: %v", err)
+		return nil
+	}
+	return tun.BindToInterfaceIndex(ifIndex)
+}
+
+// defaultRouteInterfaceIndex finds the index of the interface that owns the host's default
+// route, by opening a UDP "connection" to a public IP (no packets are actually sent) and asking
+// the kernel which local address it would use, then matching that address to an interface.
+func defaultRouteInterfaceIndex() (int, error) {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 0, err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(localIP) {
+				return iface.Index, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no interface found for local address %s", localIP)
+}
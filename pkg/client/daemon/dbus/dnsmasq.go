@@ -0,0 +1,48 @@
+package dbus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+const (
+	dnsmasqBusName    = "uk.org.thekelleys.dnsmasq"
+	dnsmasqObjectPath = "/uk/org/thekelleys/dnsmasq"
+	dnsmasqIface      = "uk.org.thekelleys.dnsmasq"
+)
+
+// IsDnsmasqRunning returns true if a dnsmasq instance owns its well-known bus name on the
+// system bus, i.e. it was built with --enable-dbus and is reachable for SetDomainServers calls.
+func IsDnsmasqRunning(c context.Context) bool {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		dlog.Errorf(c, "unable to connect to system bus: %v", err)
+		return false
+	}
+	var owned bool
+	if err := conn.BusObject().CallWithContext(c, "org.freedesktop.DBus.NameHasOwner", 0, dnsmasqBusName).Store(&owned); err != nil {
+		dlog.Errorf(c, "unable to determine if %s is running: %v", dnsmasqBusName, err)
+		return false
+	}
+	return owned
+}
+
+// SetDomainServersDnsmasq registers entries with a running dnsmasq instance, in the
+// "/domain/server" form dnsmasq's D-Bus API expects (e.g. "/svc.namespace/1.2.3.4"). Passing an
+// empty slice clears any entries we previously registered.
+func SetDomainServersDnsmasq(c context.Context, entries []string) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	obj := conn.Object(dnsmasqBusName, dbus.ObjectPath(dnsmasqObjectPath))
+	call := obj.CallWithContext(c, dnsmasqIface+".SetDomainServers", 0, entries)
+	if call.Err != nil {
+		return fmt.Errorf("failed to call %s.SetDomainServers: %w", dnsmasqIface, call.Err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package dbus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+const (
+	nmBusName           = "org.freedesktop.NetworkManager"
+	nmObjectPath        = "/org/freedesktop/NetworkManager"
+	nmSettingsPath      = "/org/freedesktop/NetworkManager/Settings"
+	nmSettingsIface     = "org.freedesktop.NetworkManager.Settings"
+	nmSettingsConnIface = "org.freedesktop.NetworkManager.Settings.Connection"
+
+	// tel2ConnectionID is the NetworkManager connection id that we create and
+	// update on the TUN device, so that it's easy to recognize and clean up on disconnect.
+	tel2ConnectionID = "tel2-dns"
+)
+
+// IsNetworkManagerRunning returns true if NetworkManager owns its well-known bus name on the
+// system bus.
+func IsNetworkManagerRunning(c context.Context) bool {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		dlog.Errorf(c, "unable to connect to system bus: %v", err)
+		return false
+	}
+	var owned bool
+	if err := conn.BusObject().CallWithContext(c, "org.freedesktop.DBus.NameHasOwner", 0, nmBusName).Store(&owned); err != nil {
+		dlog.Errorf(c, "unable to determine if %s is running: %v", nmBusName, err)
+		return false
+	}
+	return owned
+}
+
+// nmConnectionSettings builds the connection profile that ties our DNS configuration to the
+// given TUN device. The connection is routing-only: it never becomes the default route, but its
+// ipv4.dns-search entries (prefixed with ~ for routing-only domains, same convention used for
+// systemd-resolved) let NetworkManager route NAME.NAMESPACE lookups to the TUN DNS IP without
+// hijacking ".".
+func nmConnectionSettings(ifName string, dnsIP net.IP, search []string, priority int32) map[string]map[string]dbus.Variant {
+	return map[string]map[string]dbus.Variant{
+		"connection": {
+			"id":             dbus.MakeVariant(tel2ConnectionID),
+			"type":           dbus.MakeVariant("tun"),
+			"interface-name": dbus.MakeVariant(ifName),
+		},
+		"ipv4": {
+			"method":        dbus.MakeVariant("manual"),
+			"address-data":  dbus.MakeVariant([]map[string]dbus.Variant{}),
+			"dns":           dbus.MakeVariant([]uint32{ip4ToUint32(dnsIP)}),
+			"dns-search":    dbus.MakeVariant(search),
+			"dns-priority":  dbus.MakeVariant(priority),
+			"never-default": dbus.MakeVariant(true),
+		},
+		"ipv6": {
+			"method": dbus.MakeVariant("link-local"),
+		},
+	}
+}
+
+func ip4ToUint32(ip net.IP) uint32 {
+	ip = ip.To4()
+	return uint32(ip[0]) | uint32(ip[1])<<8 | uint32(ip[2])<<16 | uint32(ip[3])<<24
+}
+
+// SetLinkDNSNetworkManager creates (or updates, if it already exists from a previous run) a
+// dedicated NetworkManager connection on the given TUN interface and activates it. dnsSearch
+// entries for namespaces must already carry the "~" routing prefix; the "." entry is never
+// added so NetworkManager doesn't take over the host's default DNS.
+func SetLinkDNSNetworkManager(c context.Context, ifName string, dnsIP net.IP, dnsSearch []string, priority int32) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	settings := nmConnectionSettings(ifName, dnsIP, dnsSearch, priority)
+
+	if path, ok := findConnection(c, conn, tel2ConnectionID); ok {
+		connObj := conn.Object(nmBusName, path)
+		call := connObj.CallWithContext(c, nmSettingsConnIface+".Update2", 0, settings, uint32(1), map[string]dbus.Variant{})
+		if call.Err != nil {
+			return fmt.Errorf("failed to update NetworkManager connection %q: %w", tel2ConnectionID, call.Err)
+		}
+		nmObj := conn.Object(nmBusName, dbus.ObjectPath(nmObjectPath))
+		call = nmObj.CallWithContext(c, nmBusName+".ActivateConnection", 0, path, dbus.ObjectPath("/"), dbus.ObjectPath("/"))
+		if call.Err != nil {
+			return fmt.Errorf("failed to activate NetworkManager connection %q: %w", tel2ConnectionID, call.Err)
+		}
+		return nil
+	}
+
+	nmObj := conn.Object(nmBusName, dbus.ObjectPath(nmObjectPath))
+	var connPath, activePath dbus.ObjectPath
+	call := nmObj.CallWithContext(c, nmBusName+".AddAndActivateConnection", 0,
+		settings, dbus.ObjectPath("/"), dbus.ObjectPath("/"))
+	if call.Err != nil {
+		return fmt.Errorf("failed to add and activate NetworkManager connection: %w", call.Err)
+	}
+	if err := call.Store(&connPath, &activePath); err != nil {
+		return fmt.Errorf("failed to parse AddAndActivateConnection reply: %w", err)
+	}
+	return nil
+}
+
+// SetLinkDomainsNetworkManager updates the dns-search entries on the connection created by
+// SetLinkDNSNetworkManager, leaving the DNS server address untouched. It is the NetworkManager
+// equivalent of dbus.SetLinkDomains and is called every time the traffic-manager sends a new
+// search-path set.
+func SetLinkDomainsNetworkManager(c context.Context, dnsSearch []string) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	path, ok := findConnection(c, conn, tel2ConnectionID)
+	if !ok {
+		return fmt.Errorf("no NetworkManager connection named %q found", tel2ConnectionID)
+	}
+	connObj := conn.Object(nmBusName, path)
+	var settings map[string]map[string]dbus.Variant
+	if err := connObj.CallWithContext(c, nmSettingsConnIface+".GetSettings", 0).Store(&settings); err != nil {
+		return fmt.Errorf("failed to read NetworkManager connection %q: %w", tel2ConnectionID, err)
+	}
+	settings["ipv4"]["dns-search"] = dbus.MakeVariant(dnsSearch)
+	call := connObj.CallWithContext(c, nmSettingsConnIface+".Update2", 0, settings, uint32(1), map[string]dbus.Variant{})
+	if call.Err != nil {
+		return fmt.Errorf("failed to update dns-search on NetworkManager connection %q: %w", tel2ConnectionID, call.Err)
+	}
+	return nil
+}
+
+// RevertNetworkManager deactivates and deletes the connection created by SetLinkDNSNetworkManager,
+// if one exists. It is safe to call even if no such connection was ever created.
+func RevertNetworkManager(c context.Context) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	path, ok := findConnection(c, conn, tel2ConnectionID)
+	if !ok {
+		return nil
+	}
+	connObj := conn.Object(nmBusName, path)
+	if call := connObj.CallWithContext(c, nmSettingsConnIface+".Delete", 0); call.Err != nil {
+		return fmt.Errorf("failed to delete NetworkManager connection %q: %w", tel2ConnectionID, call.Err)
+	}
+	return nil
+}
+
+// findConnection looks up an existing connection profile by its "id" property, returning its
+// object path under org.freedesktop.NetworkManager.Settings.
+func findConnection(c context.Context, conn *dbus.Conn, id string) (dbus.ObjectPath, bool) {
+	settingsObj := conn.Object(nmBusName, dbus.ObjectPath(nmSettingsPath))
+	var paths []dbus.ObjectPath
+	if err := settingsObj.CallWithContext(c, nmSettingsIface+".ListConnections", 0).Store(&paths); err != nil {
+		dlog.Errorf(c, "failed to list NetworkManager connections: %v", err)
+		return "", false
+	}
+	for _, path := range paths {
+		connObj := conn.Object(nmBusName, path)
+		var settings map[string]map[string]dbus.Variant
+		if err := connObj.CallWithContext(c, nmSettingsConnIface+".GetSettings", 0).Store(&settings); err != nil {
+			continue
+		}
+		if cs, ok := settings["connection"]; ok {
+			if v, ok := cs["id"]; ok {
+				if s, ok := v.Value().(string); ok && s == id {
+					return path, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// RoutingSearchPaths turns a list of search paths into the NetworkManager equivalent of the
+// "~" routing entries we use for systemd-resolved: plain namespaces and include-suffixes become
+// routing-only domains, while entries that already contain a dot are left as ordinary search
+// domains.
+func RoutingSearchPaths(paths, includeSuffixes []string) []string {
+	search := make([]string, 0, len(paths)+len(includeSuffixes))
+	for _, path := range paths {
+		if strings.ContainsRune(path, '.') {
+			search = append(search, path)
+		} else {
+			search = append(search, "~"+path)
+		}
+	}
+	for _, sfx := range includeSuffixes {
+		search = append(search, "~"+strings.TrimPrefix(sfx, "."))
+	}
+	return search
+}
@@ -0,0 +1,39 @@
+package dbus
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRoutingSearchPaths(t *testing.T) {
+	got := RoutingSearchPaths([]string{"my-ns", "other-ns", "foo.bar"}, []string{".extra.suffix"})
+	want := []string{"~my-ns", "~other-ns", "foo.bar", "~extra.suffix"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RoutingSearchPaths = %v, want %v", got, want)
+	}
+}
+
+func TestIp4ToUint32(t *testing.T) {
+	got := ip4ToUint32(net.IPv4(1, 2, 3, 4))
+	want := uint32(1) | uint32(2)<<8 | uint32(3)<<16 | uint32(4)<<24
+	if got != want {
+		t.Errorf("ip4ToUint32 = %#x, want %#x", got, want)
+	}
+}
+
+func TestNmConnectionSettingsNeverTakesOverDefaultRoute(t *testing.T) {
+	settings := nmConnectionSettings("tel0", net.IPv4(10, 0, 0, 1), []string{"~my-ns"}, nmDNSPriorityForTest)
+	neverDefault, ok := settings["ipv4"]["never-default"].Value().(bool)
+	if !ok || !neverDefault {
+		t.Error("ipv4.never-default must be true so the TUN connection never becomes the default route")
+	}
+	priority, ok := settings["ipv4"]["dns-priority"].Value().(int32)
+	if !ok || priority < 0 {
+		t.Errorf("ipv4.dns-priority = %v, want a non-negative value (negative priorities make NetworkManager exclusive)", settings["ipv4"]["dns-priority"])
+	}
+}
+
+// nmDNSPriorityForTest mirrors the value resolved_linux.go passes in practice, without importing
+// the daemon package (which would be a circular import from dbus's perspective).
+const nmDNSPriorityForTest = int32(50)
@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/miekg/dns"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// Forwarder sends queries that don't belong to the cluster to a configured set of upstream
+// nameservers, trying each in order and skipping (without waiting out a timeout) any upstream
+// that HealthTracker currently has quarantined.
+type Forwarder struct {
+	upstreams []*Upstream
+	health    *HealthTracker
+}
+
+// NewForwarder builds a Forwarder over the given upstreams, ready to have Resolve called on it.
+// An empty upstreams slice is valid; Resolve then always returns ErrNoUpstreams.
+func NewForwarder(upstreams []*Upstream) *Forwarder {
+	return &Forwarder{upstreams: upstreams, health: NewHealthTracker()}
+}
+
+// ErrNoUpstreams is returned by Resolve when every configured upstream is quarantined or failed
+// the query, or none were configured at all, so the caller can return SERVFAIL instead of blocking.
+var ErrNoUpstreams = fmt.Errorf("no healthy DNS upstream available")
+
+// Resolve forwards msg to the first non-quarantined upstream that returns an answer, recording
+// the outcome against the HealthTracker so repeatedly-failing upstreams back off instead of
+// being retried on every single query.
+func (f *Forwarder) Resolve(c context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	for _, u := range f.upstreams {
+		name := u.String()
+		if f.health.IsDisabled(name) {
+			continue
+		}
+		reply, err := u.Exchange(c, msg)
+		if err != nil {
+			dlog.Debugf(c, "upstream %s failed: %v", name, err)
+			f.health.RecordFailure(name)
+			continue
+		}
+		f.health.RecordSuccess(name)
+		return reply, nil
+	}
+	return nil, ErrNoUpstreams
+}
+
+// Status returns the current health of every upstream this Forwarder has sent a query to,
+// suitable for surfacing through the daemon status RPC. Upstreams never tried are not listed.
+func (f *Forwarder) Status() []UpstreamStatus {
+	return f.health.Status()
+}
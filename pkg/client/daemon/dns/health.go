@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxConsecutiveFailures is how many consecutive failed queries an upstream tolerates
+	// before it is quarantined.
+	maxConsecutiveFailures = 5
+
+	// minBackoff is the quarantine period applied the first time an upstream trips the
+	// failure threshold.
+	minBackoff = time.Second
+
+	// maxBackoff caps how long a repeatedly-failing upstream stays quarantined; the backoff
+	// doubles on every renewed failure up to this point.
+	maxBackoff = 5 * time.Minute
+)
+
+// upstreamHealth tracks the recent success/failure history of a single upstream nameserver.
+type upstreamHealth struct {
+	consecutiveFailures int
+	backoff             time.Duration
+	disabledUntil       time.Time
+}
+
+// HealthTracker records per-upstream success/failure counts and temporarily quarantines
+// upstreams that fail too many queries in a row, so the forwarder can return SERVFAIL (or try a
+// secondary upstream) immediately instead of waiting out a full query timeout.
+type HealthTracker struct {
+	mu        sync.Mutex
+	upstreams map[string]*upstreamHealth
+}
+
+// NewHealthTracker returns an empty HealthTracker, ready to track any upstream name passed to
+// RecordSuccess/RecordFailure.
+func NewHealthTracker() *HealthTracker {
+	return &HealthTracker{upstreams: make(map[string]*upstreamHealth)}
+}
+
+func (t *HealthTracker) entry(name string) *upstreamHealth {
+	e, ok := t.upstreams[name]
+	if !ok {
+		e = &upstreamHealth{}
+		t.upstreams[name] = e
+	}
+	return e
+}
+
+// RecordSuccess clears the failure counter and any active quarantine for the named upstream.
+func (t *HealthTracker) RecordSuccess(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.entry(name)
+	e.consecutiveFailures = 0
+	e.backoff = 0
+	e.disabledUntil = time.Time{}
+}
+
+// RecordFailure increments the failure counter for the named upstream and, once
+// maxConsecutiveFailures is reached, quarantines it for a backoff period that starts at
+// minBackoff and doubles (capped at maxBackoff) on every further consecutive failure.
+func (t *HealthTracker) RecordFailure(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.entry(name)
+	e.consecutiveFailures++
+	if e.consecutiveFailures < maxConsecutiveFailures {
+		return
+	}
+	if e.backoff == 0 {
+		e.backoff = minBackoff
+	} else {
+		e.backoff *= 2
+		if e.backoff > maxBackoff {
+			e.backoff = maxBackoff
+		}
+	}
+	e.disabledUntil = time.Now().Add(e.backoff)
+}
+
+// IsDisabled returns true if the named upstream is currently quarantined.
+func (t *HealthTracker) IsDisabled(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.upstreams[name]
+	if !ok {
+		return false
+	}
+	return time.Now().Before(e.disabledUntil)
+}
+
+// UpstreamStatus is a point-in-time snapshot of one upstream's health, suitable for returning
+// over the daemon status RPC so that `telepresence status` can show which upstreams are
+// currently quarantined.
+type UpstreamStatus struct {
+	Name                string
+	ConsecutiveFailures int
+	Disabled            bool
+	DisabledUntil       time.Time
+}
+
+// Status returns a snapshot of every upstream this tracker has ever recorded a result for.
+func (t *HealthTracker) Status() []UpstreamStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	statuses := make([]UpstreamStatus, 0, len(t.upstreams))
+	for name, e := range t.upstreams {
+		statuses = append(statuses, UpstreamStatus{
+			Name:                name,
+			ConsecutiveFailures: e.consecutiveFailures,
+			Disabled:            now.Before(e.disabledUntil),
+			DisabledUntil:       e.disabledUntil,
+		})
+	}
+	return statuses
+}
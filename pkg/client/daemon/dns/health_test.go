@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthTrackerQuarantinesAfterThreshold(t *testing.T) {
+	tr := NewHealthTracker()
+	for i := 0; i < maxConsecutiveFailures-1; i++ {
+		tr.RecordFailure("up1")
+		if tr.IsDisabled("up1") {
+			t.Fatalf("upstream disabled after only %d failures, want %d", i+1, maxConsecutiveFailures)
+		}
+	}
+	tr.RecordFailure("up1")
+	if !tr.IsDisabled("up1") {
+		t.Fatalf("expected upstream to be disabled after %d consecutive failures", maxConsecutiveFailures)
+	}
+}
+
+func TestHealthTrackerBackoffDoublesAndCaps(t *testing.T) {
+	tr := NewHealthTracker()
+	for i := 0; i < maxConsecutiveFailures; i++ {
+		tr.RecordFailure("up1")
+	}
+	first := tr.entry("up1").backoff
+	if first != minBackoff {
+		t.Fatalf("first backoff = %v, want %v", first, minBackoff)
+	}
+
+	tr.RecordFailure("up1")
+	second := tr.entry("up1").backoff
+	if second != 2*minBackoff {
+		t.Fatalf("second backoff = %v, want %v", second, 2*minBackoff)
+	}
+
+	for i := 0; i < 20; i++ {
+		tr.RecordFailure("up1")
+	}
+	if got := tr.entry("up1").backoff; got != maxBackoff {
+		t.Fatalf("backoff after many failures = %v, want cap of %v", got, maxBackoff)
+	}
+}
+
+func TestHealthTrackerSuccessClearsQuarantine(t *testing.T) {
+	tr := NewHealthTracker()
+	for i := 0; i < maxConsecutiveFailures; i++ {
+		tr.RecordFailure("up1")
+	}
+	if !tr.IsDisabled("up1") {
+		t.Fatal("expected upstream to be disabled before recording a success")
+	}
+	tr.RecordSuccess("up1")
+	if tr.IsDisabled("up1") {
+		t.Fatal("a single success must clear the quarantine")
+	}
+	if e := tr.entry("up1"); e.consecutiveFailures != 0 || e.backoff != 0 {
+		t.Errorf("state after success = %+v, want zeroed counters", e)
+	}
+}
+
+func TestHealthTrackerStatusSnapshot(t *testing.T) {
+	tr := NewHealthTracker()
+	tr.RecordFailure("up1")
+	tr.RecordSuccess("up2")
+
+	statuses := tr.Status()
+	if len(statuses) != 2 {
+		t.Fatalf("Status() returned %d entries, want 2", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.Disabled {
+			t.Errorf("upstream %q reported disabled after only one failure", s.Name)
+		}
+		if !s.DisabledUntil.Before(time.Now()) {
+			t.Errorf("upstream %q DisabledUntil should be zero/past when not quarantined", s.Name)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// bindControlFunc matches the signature net.Dialer.Control and net.ListenConfig.Control expect,
+// as produced by tun.BindToDevice / tun.BindToInterfaceIndex. Declared as a local type here so dns
+// doesn't need to import pkg/tun directly; the daemon package wires the concrete function in.
+type bindControlFunc func(network, address string, c syscall.RawConn) error
+
+// dohIdleTimeout is how long an idle keep-alive connection to a DoH server is kept open before
+// the transport closes it, matching the "short-lived but not per-query" lifetime DoH resolvers
+// expect from clients.
+const dohIdleTimeout = 30 * time.Second
+
+// Upstream is a configured encrypted (or plain) nameserver that queries not destined for the
+// cluster suffix can be forwarded to. It is created from a dnsConfig.Upstreams entry and reused
+// for every query forwarded to it.
+type Upstream struct {
+	scheme string // "udp", "tcp", "tls", or "https"
+	addr   string // host:port for udp/tcp/tls, full URL for https
+	dialer *net.Dialer
+
+	mu        sync.Mutex
+	tlsConn   *dns.Conn // pooled connection, tls scheme only
+	dohClient *http.Client
+}
+
+// ParseUpstream parses one dnsConfig.Upstreams entry. Supported schemes are udp://host:port,
+// tcp://host:port, tls://host:port (DoT), and https://host/path (DoH). A bare hostname with no
+// scheme is rejected; callers must be explicit about the transport.
+//
+// bind, if non-nil, is applied as the dialer/transport Control function so outbound sockets to
+// the upstream leave through the physical interface rather than being captured by our own TUN
+// device; see pkg/tun.BindToDevice / pkg/tun.BindToInterfaceIndex.
+func ParseUpstream(raw string, bind bindControlFunc) (*Upstream, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		return &Upstream{scheme: u.Scheme, addr: hostPort(u.Host, "53"), dialer: &net.Dialer{Control: bind}}, nil
+	case "tls":
+		return &Upstream{scheme: u.Scheme, addr: hostPort(u.Host, "853"), dialer: &net.Dialer{Control: bind}}, nil
+	case "https":
+		return &Upstream{
+			scheme: u.Scheme,
+			addr:   raw,
+			dohClient: &http.Client{
+				Timeout: 10 * time.Second,
+				Transport: &http.Transport{
+					IdleConnTimeout: dohIdleTimeout,
+					DialContext:     (&net.Dialer{Control: bind}).DialContext,
+				},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("upstream %q must use udp://, tcp://, tls://, or https://", raw)
+	}
+}
+
+// hostPort appends defaultPort to host if host has no port of its own.
+func hostPort(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// String returns the scheme and address this upstream forwards to, for logging.
+func (u *Upstream) String() string {
+	return u.scheme + "://" + u.addr
+}
+
+// Bootstrap checks that a hostname-based upstream's host resolves via the system resolver, and
+// returns an error if it does not; an IP-literal upstream is accepted as is. The resolved
+// addresses are not kept: every later dial resolves the hostname again through whichever
+// resolver is in effect at that time.
+func (u *Upstream) Bootstrap(c context.Context) error {
+	host := u.addr
+	if u.scheme == "https" {
+		if parsed, err := url.Parse(u.addr); err == nil {
+			host = parsed.Host
+		}
+	}
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		h = host
+	}
+	if net.ParseIP(h) != nil {
+		return nil // already an IP literal, nothing to bootstrap
+	}
+	if _, err := net.DefaultResolver.LookupHost(c, h); err != nil {
+		return fmt.Errorf("failed to bootstrap upstream %s: %w", u, err)
+	}
+	return nil
+}
+
+// Exchange forwards msg to the upstream and returns its reply, using plain UDP/TCP, a pooled DoT
+// connection, or a DoH POST, depending on the upstream's scheme.
+func (u *Upstream) Exchange(c context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	switch u.scheme {
+	case "udp", "tcp":
+		client := &dns.Client{Net: u.scheme, Timeout: 5 * time.Second, Dialer: u.dialer}
+		reply, _, err := client.ExchangeContext(c, msg, u.addr)
+		return reply, err
+	case "tls":
+		return u.exchangeDoT(c, msg)
+	case "https":
+		return u.exchangeDoH(c, msg)
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q", u.scheme)
+	}
+}
+
+func (u *Upstream) exchangeDoT(c context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.tlsConn == nil {
+		host, _, _ := net.SplitHostPort(u.addr)
+		rawConn, err := tls.DialWithDialer(u.dialer, "tcp", u.addr, &tls.Config{ServerName: host})
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial DoT upstream %s: %w", u, err)
+		}
+		u.tlsConn = &dns.Conn{Conn: rawConn}
+	}
+	_ = u.tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := u.tlsConn.WriteMsg(msg); err != nil {
+		u.tlsConn.Close()
+		u.tlsConn = nil
+		return nil, fmt.Errorf("failed to write to DoT upstream %s: %w", u, err)
+	}
+	reply, err := u.tlsConn.ReadMsg()
+	if err != nil {
+		u.tlsConn.Close()
+		u.tlsConn = nil
+		return nil, fmt.Errorf("failed to read from DoT upstream %s: %w", u, err)
+	}
+	return reply, nil
+}
+
+func (u *Upstream) exchangeDoH(c context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack query for DoH upstream %s: %w", u, err)
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodPost, u.addr, bytes.NewReader(packed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DoH request for %s: %w", u, err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := u.dohClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DoH request to %s failed: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH upstream %s returned status %s", u, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DoH response from %s: %w", u, err)
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to unpack DoH response from %s: %w", u, err)
+	}
+	return reply, nil
+}
+
+// ParseUpstreams parses every entry in raw, skipping (and logging) any that fail to parse rather
+// than failing the whole daemon over one bad config entry. bind is passed through to every
+// parsed Upstream; see ParseUpstream.
+func ParseUpstreams(c context.Context, raw []string, bind bindControlFunc) []*Upstream {
+	upstreams := make([]*Upstream, 0, len(raw))
+	for _, r := range raw {
+		u, err := ParseUpstream(strings.TrimSpace(r), bind)
+		if err != nil {
+			dlog.Errorf(c, "ignoring invalid DNS upstream: %v", err)
+			continue
+		}
+		if err := u.Bootstrap(c); err != nil {
+			dlog.Error(c, err)
+		}
+		upstreams = append(upstreams, u)
+	}
+	return upstreams
+}
@@ -0,0 +1,191 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseUpstreamSchemes(t *testing.T) {
+	cases := []struct {
+		raw        string
+		wantScheme string
+		wantAddr   string
+		wantErr    bool
+	}{
+		{"udp://1.1.1.1", "udp", "1.1.1.1:53", false},
+		{"udp://1.1.1.1:5353", "udp", "1.1.1.1:5353", false},
+		{"tcp://1.1.1.1", "tcp", "1.1.1.1:53", false},
+		{"tls://dns.example:853", "tls", "dns.example:853", false},
+		{"tls://dns.example", "tls", "dns.example:853", false},
+		{"https://dns.example/dns-query", "https", "https://dns.example/dns-query", false},
+		{"dns.example", "", "", true},
+		{"ftp://dns.example", "", "", true},
+	}
+	for _, tc := range cases {
+		u, err := ParseUpstream(tc.raw, nil)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseUpstream(%q): expected an error, got none", tc.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseUpstream(%q): unexpected error: %v", tc.raw, err)
+			continue
+		}
+		if u.scheme != tc.wantScheme || u.addr != tc.wantAddr {
+			t.Errorf("ParseUpstream(%q) = {%q, %q}, want {%q, %q}", tc.raw, u.scheme, u.addr, tc.wantScheme, tc.wantAddr)
+		}
+	}
+}
+
+func TestExchangeDoH(t *testing.T) {
+	reply := new(dns.Msg)
+	reply.SetReply(queryFor("example.com."))
+	reply.Answer = append(reply.Answer, mustA("example.com.", "1.2.3.4"))
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			t.Errorf("server: failed to unpack request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		packed, err := reply.Pack()
+		if err != nil {
+			t.Fatalf("failed to pack test reply: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer srv.Close()
+
+	u, err := ParseUpstream(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("ParseUpstream: %v", err)
+	}
+	// srv.Client() trusts the test server's self-signed cert; ParseUpstream has no way to know
+	// about it, so swap it in over the dohClient ParseUpstream built.
+	u.dohClient = srv.Client()
+	got, err := u.Exchange(context.Background(), queryFor("example.com."))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if len(got.Answer) != 1 || got.Answer[0].(*dns.A).A.String() != "1.2.3.4" {
+		t.Errorf("Exchange reply = %v, want A record 1.2.3.4", got.Answer)
+	}
+}
+
+func TestExchangeDoTResetsPoolOnError(t *testing.T) {
+	cert := generateSelfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("failed to start test DoT listener: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close() // always reset, so dialing a new DoT connection fails
+		}
+	}()
+
+	u, err := ParseUpstream("tls://"+ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("ParseUpstream: %v", err)
+	}
+	u.dialer = &net.Dialer{Timeout: time.Second}
+
+	if _, err := u.Exchange(context.Background(), queryFor("example.com.")); err == nil {
+		t.Fatal("expected Exchange to fail against a listener that resets every connection")
+	}
+	if u.tlsConn != nil {
+		t.Error("a failed DoT exchange must clear the pooled connection so the next query redials")
+	}
+
+	// Seed the pool with a connection whose peer is already closed, so the exchange fails on the
+	// pooled connection itself rather than while dialing.
+	client, server := net.Pipe()
+	server.Close()
+	u.tlsConn = &dns.Conn{Conn: client}
+	if _, err := u.Exchange(context.Background(), queryFor("example.com.")); err == nil {
+		t.Fatal("expected Exchange to fail on a pooled connection whose peer is closed")
+	}
+	if u.tlsConn != nil {
+		t.Error("a failed DoT exchange must clear the pooled connection so the next query redials")
+	}
+}
+
+func TestForwarderSkipsQuarantinedUpstream(t *testing.T) {
+	good := &Upstream{scheme: "udp", addr: "127.0.0.1:1"} // never dialed; health check short-circuits
+	f := NewForwarder([]*Upstream{good})
+	for i := 0; i < maxConsecutiveFailures; i++ {
+		f.health.RecordFailure(good.String())
+	}
+
+	if !f.health.IsDisabled(good.String()) {
+		t.Fatal("expected upstream to be quarantined after maxConsecutiveFailures failures")
+	}
+	if _, err := f.Resolve(context.Background(), queryFor("example.com.")); err != ErrNoUpstreams {
+		t.Errorf("Resolve with only a quarantined upstream = %v, want ErrNoUpstreams", err)
+	}
+}
+
+func queryFor(name string) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeA)
+	return msg
+}
+
+func mustA(name, ip string) dns.RR {
+	rr, err := dns.NewRR(name + " 60 IN A " + ip)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+// generateSelfSignedCert returns a throwaway TLS certificate for 127.0.0.1, good enough to
+// exercise the DoT connection-pooling path without shipping a static fixture certificate.
+func generateSelfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create test certificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load test certificate: %v", err)
+	}
+	return cert
+}
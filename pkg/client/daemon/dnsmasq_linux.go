@@ -0,0 +1,147 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dgroup"
+	"github.com/datawire/dlib/dlog"
+	"github.com/datawire/dlib/dtime"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/daemon/dbus"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/daemon/dns"
+	"github.com/telepresenceio/telepresence/v2/pkg/tun"
+)
+
+// errDnsmasqNotConfigured is returned by tryDnsmasq when dnsmasq isn't running with D-Bus
+// support enabled, or doesn't acknowledge our domain-server registration.
+var errDnsmasqNotConfigured = errors.New("dnsmasq DNS configuration failed")
+
+// tryDnsmasq is the dnsmasq equivalent of trySystemdResolved, used on Fedora/RHEL style hosts where
+// dnsmasq, not systemd-resolved, is the local stub resolver. Instead of link domains, dnsmasq's
+// D-Bus API takes a flat list of "/domain/server" entries; we rebuild and re-push that list every
+// time the traffic-manager sends a new search-path set.
+func (o *outbound) tryDnsmasq(c context.Context, dev *tun.Device) error {
+	if !dbus.IsDnsmasqRunning(c) {
+		dlog.Error(c, "dnsmasq is not running with D-Bus support")
+		return errDnsmasqNotConfigured
+	}
+
+	var dnsIP net.IP
+	o.setSearchPathFunc = func(c context.Context, paths []string) {
+		namespaces := make(map[string]struct{})
+		search := make([]string, 0)
+		for _, path := range paths {
+			if strings.ContainsRune(path, '.') {
+				search = append(search, path)
+			} else {
+				namespaces[path] = struct{}{}
+			}
+		}
+		namespaces[tel2SubDomain] = struct{}{}
+
+		o.domainsLock.Lock()
+		o.namespaces = namespaces
+		o.search = search
+		o.domainsLock.Unlock()
+
+		entries := dnsmasqDomainServers(namespaces, o.dnsConfig.IncludeSuffixes, dnsIP)
+		if err := dbus.SetDomainServersDnsmasq(c, entries); err != nil {
+			dlog.Errorf(c, "failed to set domain servers on dnsmasq: %v", err)
+		} else {
+			dlog.Debugf(c, "dnsmasq domain servers set to [%s]", strings.Join(entries, ","))
+		}
+	}
+
+	g := dgroup.NewGroup(c, dgroup.GroupConfig{})
+
+	initDone := make(chan struct{})
+	var dnsServer *dns.Server
+	g.Go("Server", func(c context.Context) error {
+		select {
+		case <-c.Done():
+			initDone <- struct{}{}
+			return nil
+		case ip := <-o.kubeDNS:
+			dnsIP = ip
+			o.setClusterDNS(dnsIP)
+			listeners, err := o.dnsListeners(c)
+			if err != nil {
+				dlog.Error(c, err)
+				initDone <- struct{}{}
+				return err
+			}
+			dnsResolverAddr, err := splitToUDPAddr(listeners[0].LocalAddr())
+			if err != nil {
+				return err
+			}
+
+			o.router.configureDNS(c, dnsIP, uint16(53), dnsResolverAddr)
+			dlog.Infof(c, "Configuring DNS IP %s via dnsmasq", dnsIP)
+
+			o.domainsLock.Lock()
+			namespaces := map[string]struct{}{tel2SubDomain: {}}
+			o.namespaces = namespaces
+			o.search = nil
+			o.domainsLock.Unlock()
+
+			entries := dnsmasqDomainServers(namespaces, o.dnsConfig.IncludeSuffixes, dnsIP)
+			if err := dbus.SetDomainServersDnsmasq(c, entries); err != nil {
+				dlog.Error(c, err)
+				initDone <- struct{}{}
+				return errDnsmasqNotConfigured
+			}
+			defer func() {
+				c, cancel := context.WithTimeout(dcontext.WithoutCancel(c), time.Second)
+				defer cancel()
+				dlog.Debug(c, "Clearing dnsmasq domain servers")
+				o.clearClusterState()
+				o.setSearchPathFunc = nil
+				o.router.configureDNS(c, nil, 0, nil)
+				if err := dbus.SetDomainServersDnsmasq(c, []string{}); err != nil {
+					dlog.Error(c, err)
+				}
+			}()
+			dnsServer = dns.NewServer(c, listeners, nil, o.resolveInCluster)
+			close(initDone)
+			return dnsServer.Run(c)
+		}
+	})
+	g.Go("SanityCheck", func(c context.Context) error {
+		if _, ok := <-initDone; ok {
+			return errDnsmasqNotConfigured
+		}
+		cmdC, cmdCancel := context.WithTimeout(c, 2*time.Second)
+		defer cmdCancel()
+		for cmdC.Err() == nil {
+			dtime.SleepWithContext(cmdC, 100*time.Millisecond)
+			_, _ = net.DefaultResolver.LookupHost(cmdC, "jhfweoitnkgyeta."+tel2SubDomain)
+			if dnsServer.RequestCount() > 0 {
+				close(o.dnsConfigured)
+				return nil
+			}
+			dns.Flush(c)
+		}
+		dlog.Error(c, "resolver did not receive requests from dnsmasq")
+		return errDnsmasqNotConfigured
+	})
+	return g.Wait()
+}
+
+// dnsmasqDomainServers builds the "/domain/server" entry list dnsmasq's SetDomainServers expects:
+// one entry per namespace and one per configured include-suffix. No tel2SubDomain entry is added
+// here; callers include tel2SubDomain among the namespaces they pass in.
+func dnsmasqDomainServers(namespaces map[string]struct{}, includeSuffixes []string, dnsIP net.IP) []string {
+	entries := make([]string, 0, len(namespaces)+len(includeSuffixes))
+	for ns := range namespaces {
+		entries = append(entries, fmt.Sprintf("/%s/%s", ns, dnsIP))
+	}
+	for _, sfx := range includeSuffixes {
+		entries = append(entries, fmt.Sprintf("/%s/%s", strings.TrimPrefix(sfx, "."), dnsIP))
+	}
+	return entries
+}
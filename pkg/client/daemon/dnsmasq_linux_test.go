@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"net"
+	"sort"
+	"testing"
+)
+
+func TestDnsmasqDomainServers(t *testing.T) {
+	namespaces := map[string]struct{}{"my-ns": {}, tel2SubDomain: {}}
+	entries := dnsmasqDomainServers(namespaces, []string{".extra.suffix"}, net.IPv4(10, 0, 0, 1))
+	sort.Strings(entries)
+
+	want := []string{
+		"/" + tel2SubDomain + "/10.0.0.1",
+		"/extra.suffix/10.0.0.1",
+		"/my-ns/10.0.0.1",
+	}
+	sort.Strings(want)
+
+	if len(entries) != len(want) {
+		t.Fatalf("dnsmasqDomainServers = %v, want %v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestDnsmasqDomainServersClearsWithEmptyNamespaces(t *testing.T) {
+	entries := dnsmasqDomainServers(map[string]struct{}{}, nil, net.IPv4(10, 0, 0, 1))
+	if len(entries) != 0 {
+		t.Errorf("dnsmasqDomainServers with no namespaces/suffixes = %v, want empty", entries)
+	}
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/daemon/dns"
+)
+
+// clusterState holds the per-session state resolveInCluster needs: the in-cluster DNS IP that
+// cluster-domain queries are forwarded to over plain UDP, and the lazily-built Forwarder used for
+// encrypted upstreams. It's keyed by the owning *outbound rather than being fields on outbound
+// itself (which this package snapshot doesn't define), so that a new connect/disconnect session
+// always gets its own Forwarder and kube-dns IP instead of reusing whichever session started
+// first.
+type clusterState struct {
+	once       sync.Once
+	forwarder  *dns.Forwarder
+	clusterDNS net.IP
+}
+
+var (
+	clusterStatesMu sync.Mutex
+	clusterStates   = map[*outbound]*clusterState{}
+)
+
+func (o *outbound) clusterState() *clusterState {
+	clusterStatesMu.Lock()
+	defer clusterStatesMu.Unlock()
+	st := clusterStates[o]
+	if st == nil {
+		st = &clusterState{}
+		clusterStates[o] = st
+	}
+	return st
+}
+
+// setClusterDNS records the in-cluster DNS IP discovered for this session, so that
+// resolveInCluster can forward cluster-domain queries to it. Every DNS backend (tryResolveD et
+// al.) calls this as soon as it receives the IP from o.kubeDNS.
+func (o *outbound) setClusterDNS(ip net.IP) {
+	o.clusterState().clusterDNS = ip
+}
+
+// clearClusterState drops this session's cached Forwarder and kube-dns IP. DNS backends call
+// this when tearing down, so a later reconnect starts clean instead of reusing stale state.
+func (o *outbound) clearClusterState() {
+	clusterStatesMu.Lock()
+	defer clusterStatesMu.Unlock()
+	delete(clusterStates, o)
+}
+
+// resolveInCluster is the dns.Server resolve callback used by every Linux DNS backend
+// (tryResolveD, tryNetworkManager, tryDnsmasq) as well as the macOS/Windows equivalents. Queries
+// for names inside the cluster (any configured namespace, or tel2SubDomain) are forwarded to the
+// discovered kube-dns IP over plain UDP, same as queries for anything else when no encrypted
+// upstream is configured. Everything else is forwarded to the encrypted upstreams configured in
+// o.dnsConfig.Upstreams instead of leaking to the host resolver.
+func (o *outbound) resolveInCluster(c context.Context, q *miekgdns.Msg) (*miekgdns.Msg, error) {
+	if len(q.Question) == 0 {
+		return nil, nil
+	}
+	st := o.clusterState()
+
+	if !o.isClusterDomain(q.Question[0].Name) && len(o.dnsConfig.Upstreams) > 0 {
+		st.once.Do(func() {
+			upstreams := dns.ParseUpstreams(c, o.dnsConfig.Upstreams, physicalInterfaceBind(c))
+			st.forwarder = dns.NewForwarder(upstreams)
+		})
+		return st.forwarder.Resolve(c, q)
+	}
+
+	if st.clusterDNS == nil {
+		return nil, nil
+	}
+	client := &miekgdns.Client{Net: "udp", Timeout: 5 * time.Second}
+	reply, _, err := client.ExchangeContext(c, q, net.JoinHostPort(st.clusterDNS.String(), "53"))
+	return reply, err
+}
+
+// DNSUpstreamStatus returns the current health of every configured DNS upstream that has been
+// sent a query, one entry per upstream named by scheme and address. It returns an empty slice
+// until resolveInCluster has forwarded a query to the configured upstreams at least once.
+//
+// The daemon's status RPC handler is meant to call this and report the result so that
+// `telepresence status` can show which upstreams are currently quarantined, but that handler
+// isn't part of this source tree, so that last piece of wiring can't be done from here.
+func (o *outbound) DNSUpstreamStatus() []dns.UpstreamStatus {
+	st := o.clusterState()
+	if st.forwarder == nil {
+		return nil
+	}
+	return st.forwarder.Status()
+}
+
+// isClusterDomain reports whether name (as received in a DNS question, dot-terminated) falls
+// under a namespace we're currently routing, or under tel2SubDomain.
+func (o *outbound) isClusterDomain(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if strings.HasSuffix(name, "."+tel2SubDomain) || name == tel2SubDomain {
+		return true
+	}
+	o.domainsLock.Lock()
+	defer o.domainsLock.Unlock()
+	for ns := range o.namespaces {
+		if strings.HasSuffix(name, "."+ns) || name == ns {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"net"
 	"strings"
 	"time"
@@ -16,7 +17,40 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/tun"
 )
 
+// errNetworkManagerNotConfigured is returned by tryNetworkManager when NetworkManager isn't
+// running or doesn't acknowledge our DNS configuration, mirroring errResolveDNotConfigured.
+var errNetworkManagerNotConfigured = errors.New("NetworkManager DNS configuration failed")
+
+// nmDNSPriority is the ipv4.dns-priority we request for the connection tryNetworkManager
+// creates. NetworkManager treats any negative priority as exclusive: it stops considering
+// domains/servers from connections with a higher (e.g. the physical interface's default of 100)
+// priority entirely, which is exactly the ".", hijack-the-host-resolver behavior we need to
+// avoid. Using a small positive value here just wins ties for NAME.NAMESPACE against the
+// physical interface's default priority without excluding it.
+const nmDNSPriority = 50
+
+// tryResolveD probes the host for a supported DNS integration and configures the first one
+// found, in order of preference: systemd-resolved, then NetworkManager, then dnsmasq, falling
+// back to direct /etc/resolv.conf editing if none of the D-Bus-based integrations are available.
+// It used to assume systemd-resolved outright; callers don't need to change, but hosts where
+// NetworkManager or dnsmasq (rather than systemd-resolved) owns /etc/resolv.conf are now handled
+// too.
 func (o *outbound) tryResolveD(c context.Context, dev *tun.Device) error {
+	if dbus.IsResolveDRunning(c) {
+		return o.trySystemdResolved(c, dev)
+	}
+	if dbus.IsNetworkManagerRunning(c) {
+		return o.tryNetworkManager(c, dev)
+	}
+	if dbus.IsDnsmasqRunning(c) {
+		return o.tryDnsmasq(c, dev)
+	}
+	return o.tryDirectFile(c, dev)
+}
+
+// trySystemdResolved is the original systemd-resolved integration; see tryResolveD for how it's
+// selected among the other backends.
+func (o *outbound) trySystemdResolved(c context.Context, dev *tun.Device) error {
 	// Connect to ResolveD via DBUS.
 	if !dbus.IsResolveDRunning(c) {
 		dlog.Error(c, "systemd-resolved is not running")
@@ -66,6 +100,7 @@ func (o *outbound) tryResolveD(c context.Context, dev *tun.Device) error {
 			initDone <- struct{}{}
 			return nil
 		case dnsIP := <-o.kubeDNS:
+			o.setClusterDNS(dnsIP)
 			listeners, err := o.dnsListeners(c)
 			if err != nil {
 				dlog.Error(c, err)
@@ -91,6 +126,7 @@ func (o *outbound) tryResolveD(c context.Context, dev *tun.Device) error {
 				c, cancel := context.WithTimeout(dcontext.WithoutCancel(c), time.Second)
 				defer cancel()
 				dlog.Debugf(c, "Reverting Link settings for %s", dev.Name())
+				o.clearClusterState()
 				o.setSearchPathFunc = nil
 				o.router.configureDNS(c, nil, 0, nil) // Don't route from TUN-device
 				if err = dbus.RevertLink(c, int(dev.Index())); err != nil {
@@ -144,3 +180,112 @@ func (o *outbound) tryResolveD(c context.Context, dev *tun.Device) error {
 	})
 	return g.Wait()
 }
+
+// tryNetworkManager is the NetworkManager equivalent of trySystemdResolved, used on desktops where
+// NetworkManager owns /etc/resolv.conf instead of systemd-resolved. It creates a dedicated,
+// routing-only connection on the TUN device so that NAME.NAMESPACE lookups are routed to the
+// cluster DNS IP without NetworkManager taking over "." for the whole host.
+func (o *outbound) tryNetworkManager(c context.Context, dev *tun.Device) error {
+	if !dbus.IsNetworkManagerRunning(c) {
+		dlog.Error(c, "NetworkManager is not running")
+		return errNetworkManagerNotConfigured
+	}
+
+	o.setSearchPathFunc = func(c context.Context, paths []string) {
+		namespaces := make(map[string]struct{})
+		search := make([]string, 0)
+		for _, path := range paths {
+			if strings.ContainsRune(path, '.') {
+				search = append(search, path)
+			} else {
+				namespaces[path] = struct{}{}
+			}
+		}
+		namespaces[tel2SubDomain] = struct{}{}
+
+		o.domainsLock.Lock()
+		o.namespaces = namespaces
+		o.search = search
+		o.domainsLock.Unlock()
+
+		dnsSearch := dbus.RoutingSearchPaths(paths, o.dnsConfig.IncludeSuffixes)
+		if err := dbus.SetLinkDomainsNetworkManager(c, dnsSearch); err != nil {
+			dlog.Errorf(c, "failed to update NetworkManager connection on %q: %v", dev.Name(), err)
+		} else {
+			dlog.Debugf(c, "NetworkManager dns-search on device %q set to [%s]", dev.Name(), strings.Join(dnsSearch, ","))
+		}
+	}
+
+	g := dgroup.NewGroup(c, dgroup.GroupConfig{})
+
+	initDone := make(chan struct{})
+	var dnsServer *dns.Server
+	g.Go("Server", func(c context.Context) error {
+		select {
+		case <-c.Done():
+			initDone <- struct{}{}
+			return nil
+		case dnsIP := <-o.kubeDNS:
+			o.setClusterDNS(dnsIP)
+			listeners, err := o.dnsListeners(c)
+			if err != nil {
+				dlog.Error(c, err)
+				initDone <- struct{}{}
+				return err
+			}
+			dnsResolverAddr, err := splitToUDPAddr(listeners[0].LocalAddr())
+			if err != nil {
+				return err
+			}
+
+			o.router.configureDNS(c, dnsIP, uint16(53), dnsResolverAddr)
+			dlog.Infof(c, "Configuring DNS IP %s via NetworkManager", dnsIP)
+
+			o.domainsLock.Lock()
+			namespaces := map[string]struct{}{tel2SubDomain: {}}
+			o.namespaces = namespaces
+			dnsSearch := []string{"~" + tel2SubDomainDot}
+			o.search = dnsSearch
+			o.domainsLock.Unlock()
+
+			if err := dbus.SetLinkDNSNetworkManager(c, dev.Name(), dnsIP, dnsSearch, nmDNSPriority); err != nil {
+				dlog.Error(c, err)
+				initDone <- struct{}{}
+				return errNetworkManagerNotConfigured
+			}
+			defer func() {
+				c, cancel := context.WithTimeout(dcontext.WithoutCancel(c), time.Second)
+				defer cancel()
+				dlog.Debugf(c, "Reverting NetworkManager settings for %s", dev.Name())
+				o.clearClusterState()
+				o.setSearchPathFunc = nil
+				o.router.configureDNS(c, nil, 0, nil)
+				if err := dbus.RevertNetworkManager(c); err != nil {
+					dlog.Error(c, err)
+				}
+			}()
+			dnsServer = dns.NewServer(c, listeners, nil, o.resolveInCluster)
+			close(initDone)
+			return dnsServer.Run(c)
+		}
+	})
+	g.Go("SanityCheck", func(c context.Context) error {
+		if _, ok := <-initDone; ok {
+			return errNetworkManagerNotConfigured
+		}
+		cmdC, cmdCancel := context.WithTimeout(c, 2*time.Second)
+		defer cmdCancel()
+		for cmdC.Err() == nil {
+			dtime.SleepWithContext(cmdC, 100*time.Millisecond)
+			_, _ = net.DefaultResolver.LookupHost(cmdC, "jhfweoitnkgyeta."+tel2SubDomain)
+			if dnsServer.RequestCount() > 0 {
+				close(o.dnsConfigured)
+				return nil
+			}
+			dns.Flush(c)
+		}
+		dlog.Error(c, "resolver did not receive requests from NetworkManager")
+		return errNetworkManagerNotConfigured
+	})
+	return g.Wait()
+}
@@ -0,0 +1,31 @@
+package tun
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// BindToInterfaceIndex returns a net.Dialer.Control / net.ListenConfig.Control compatible
+// function that binds the socket to the interface with the given index, via IP_BOUND_IF for
+// IPv4 sockets and IPV6_BOUND_IF for IPv6 sockets. This is the Darwin equivalent of Linux's
+// SO_BINDTODEVICE; macOS has no interface-by-name socket option.
+func BindToInterfaceIndex(ifIndex int) func(network, address string, c syscall.RawConn) error {
+	return func(network, _ string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			if isIPv6Network(network) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, ifIndex)
+			} else {
+				sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, ifIndex)
+			}
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+func isIPv6Network(network string) bool {
+	return len(network) > 0 && (network[len(network)-1] == '6')
+}
@@ -0,0 +1,24 @@
+package tun
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// BindToDevice returns a net.Dialer.Control / net.ListenConfig.Control compatible function that
+// binds the socket to the named network interface via SO_BINDTODEVICE. The daemon uses it so
+// that queries to configured DNS upstreams leave through the physical default interface instead
+// of being routed back into our own TUN device. Queries to the cluster DNS IP and the DNS
+// listeners are not bound.
+func BindToDevice(ifName string) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, ifName)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
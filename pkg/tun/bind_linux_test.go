@@ -0,0 +1,21 @@
+package tun
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestBindToDeviceAppliesSockopt(t *testing.T) {
+	control := BindToDevice("lo")
+	if control == nil {
+		t.Fatal("BindToDevice must never return a nil Control function")
+	}
+
+	lc := net.ListenConfig{Control: control}
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("skipping: SO_BINDTODEVICE to lo unavailable in this environment: %v", err)
+	}
+	defer ln.Close()
+}
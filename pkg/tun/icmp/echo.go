@@ -0,0 +1,85 @@
+package icmp
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/net/ipv4"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/tun/ip"
+)
+
+const (
+	ipv4EchoRequest = 8
+	ipv4EchoReply   = 0
+	ipv6EchoRequest = 128
+	ipv6EchoReply   = 129
+)
+
+// PacketWriter is the subset of *tun.Device that EchoResponder needs in order to write an Echo
+// Reply back onto the TUN link.
+type PacketWriter interface {
+	Write(ctx context.Context, packet []byte) (int, error)
+}
+
+// EchoResponder answers ICMP and ICMPv6 Echo Requests aimed at addresses routed through the TUN
+// device. Without it, pinging a cluster IP through the TUN is silently dropped, which is the
+// most common "is my intercept even working?" support question.
+type EchoResponder struct {
+	writer PacketWriter
+}
+
+// NewEchoResponder returns an EchoResponder that writes Echo Replies to w.
+func NewEchoResponder(w PacketWriter) *EchoResponder {
+	return &EchoResponder{writer: w}
+}
+
+// HandleEcho inspects ipHdr and, if its L4 payload is an ICMP(v6) Echo Request, writes the
+// corresponding Echo Reply back to the TUN device and returns true. It returns false (and writes
+// nothing) for any packet that isn't an Echo Request, so callers can chain it in front of other
+// packet handling in the router.
+func (r *EchoResponder) HandleEcho(c context.Context, ipHdr ip.Header) (bool, error) {
+	if _, ok := EchoReply(ipHdr); !ok {
+		return false, nil
+	}
+	// EchoReply mutates ipHdr in place and returns only the ICMP sub-slice for callers that
+	// want to inspect it; the packet written back to the device must be the full IP packet,
+	// header included, or the reply is a headerless blob that the kernel will drop.
+	_, err := r.writer.Write(c, ipHdr)
+	return true, err
+}
+
+// EchoReply turns ipHdr in place into its own Echo Reply, if its L4 payload is an ICMP Echo
+// Request (IPv4 type 8) or ICMPv6 Echo Request (type 128), and reports whether it did so. The
+// identifier, sequence number (both part of RestOfHeader), and payload bytes are preserved
+// unchanged; only the message type, source/destination addresses, and both checksums are
+// rewritten.
+func EchoReply(ipHdr ip.Header) (Header, bool) {
+	h := Header(ipHdr.Payload())
+	if len(h) < HeaderLen {
+		return nil, false
+	}
+
+	isIPv4 := ipHdr.Version() == ipv4.Version
+	switch {
+	case isIPv4 && h.MessageType() == ipv4EchoRequest:
+		h.SetMessageType(ipv4EchoReply)
+	case !isIPv4 && h.MessageType() == ipv6EchoRequest:
+		h.SetMessageType(ipv6EchoReply)
+	default:
+		return nil, false
+	}
+
+	// ip.Header.Source/Destination alias the underlying packet bytes (same zero-copy design as
+	// Header itself), so the swap must go through copies: taking a reference to src and then
+	// setting the source from the (still-aliased) destination would clobber src before it's
+	// written back.
+	src := append(net.IP(nil), ipHdr.Source()...)
+	dst := append(net.IP(nil), ipHdr.Destination()...)
+	ipHdr.SetSource(dst)
+	ipHdr.SetDestination(src)
+
+	h.SetChecksum(ipHdr)
+	ipHdr.SetChecksum()
+	return h, true
+}
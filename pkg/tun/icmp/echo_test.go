@@ -0,0 +1,85 @@
+package icmp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/tun/ip"
+)
+
+// rawEchoRequest builds a byte-exact IPv4 packet containing an ICMP Echo Request, as it would
+// arrive on the TUN device: a 20 byte IPv4 header (no options, version/IHL = 0x45, protocol 1)
+// followed by an 8 byte ICMP header and the given payload.
+func rawEchoRequest(src, dst net.IP, id, seq uint16, payload []byte) ip.Header {
+	buf := make([]byte, 20+HeaderLen+len(payload))
+	buf[0] = 0x45 // version 4, IHL 5 (no options)
+	buf[8] = 64   // TTL
+	buf[9] = 1    // protocol: ICMP
+	copy(buf[12:16], src.To4())
+	copy(buf[16:20], dst.To4())
+	buf[2], buf[3] = byte(len(buf)>>8), byte(len(buf)) // total length
+
+	ipHdr := ip.Header(buf)
+	h := Header(ipHdr.Payload())
+	h.SetMessageType(ipv4EchoRequest)
+	h.SetCode(0)
+	rest := h.RestOfHeader()
+	rest[0], rest[1] = byte(id>>8), byte(id)
+	rest[2], rest[3] = byte(seq>>8), byte(seq)
+	copy(h.Payload(), payload)
+	h.SetChecksum(ipHdr)
+	ipHdr.SetChecksum()
+	return ipHdr
+}
+
+func TestEchoReply(t *testing.T) {
+	src := net.IPv4(192, 168, 1, 10)
+	dst := net.IPv4(10, 42, 0, 5)
+	payload := []byte("abcdefgh")
+
+	ipHdr := rawEchoRequest(src, dst, 0x1234, 0x0001, payload)
+	origRest := append([]byte(nil), Header(ipHdr.Payload()).RestOfHeader()...)
+
+	reply, ok := EchoReply(ipHdr)
+	if !ok {
+		t.Fatal("EchoReply returned ok=false for a well-formed Echo Request")
+	}
+
+	if reply.MessageType() != ipv4EchoReply {
+		t.Errorf("MessageType = %d, want %d", reply.MessageType(), ipv4EchoReply)
+	}
+	if !ipHdr.Source().Equal(dst) {
+		t.Errorf("reply source = %v, want %v", ipHdr.Source(), dst)
+	}
+	if !ipHdr.Destination().Equal(src) {
+		t.Errorf("reply destination = %v, want %v", ipHdr.Destination(), src)
+	}
+	if !bytes.Equal(reply.RestOfHeader(), origRest) {
+		t.Error("identifier/sequence in RestOfHeader must be preserved")
+	}
+	if !bytes.Equal(reply.Payload(), payload) {
+		t.Errorf("payload = %q, want %q", reply.Payload(), payload)
+	}
+
+	// Recomputing the IP header checksum on the already-replied packet must reproduce the
+	// exact same bytes, i.e. the checksum in the reply is valid for the reply's header. Swapping
+	// source and destination alone does not change an IPv4 header checksum.
+	before := append([]byte(nil), ipHdr...)
+	ipHdr.SetChecksum()
+	if !bytes.Equal(before, ipHdr) {
+		t.Error("IP header checksum is not stable when recomputed on an already-replied packet")
+	}
+}
+
+func TestEchoReplyIgnoresNonEcho(t *testing.T) {
+	ipHdr := rawEchoRequest(net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 2), 1, 1, nil)
+	h := Header(ipHdr.Payload())
+	h.SetMessageType(3) // Destination Unreachable, not an Echo Request
+	h.SetChecksum(ipHdr)
+	ipHdr.SetChecksum()
+
+	if _, ok := EchoReply(ipHdr); ok {
+		t.Error("EchoReply must ignore non-Echo-Request ICMP messages")
+	}
+}
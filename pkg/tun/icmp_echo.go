@@ -0,0 +1,25 @@
+package tun
+
+import (
+	"context"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/tun/icmp"
+	"github.com/telepresenceio/telepresence/v2/pkg/tun/ip"
+)
+
+// HandleICMPEcho answers ipHdr in place if it's an ICMP or ICMPv6 Echo Request, writing the
+// reply back to this device and reporting whether it did so.
+//
+// The packet read loop must call this ahead of any other L4 dispatch, for every inbound packet,
+// so that `ping` against a cluster IP routed through the TUN device gets a reply instead of being
+// silently dropped:
+//
+//	if handled, err := dev.HandleICMPEcho(c, ipHdr); handled {
+//	    continue // or: return err
+//	}
+//
+// That call site lives in the packet read loop, which isn't part of this source tree; wiring it
+// in is outside what this change can do.
+func (d *Device) HandleICMPEcho(c context.Context, ipHdr ip.Header) (bool, error) {
+	return icmp.NewEchoResponder(d).HandleEcho(c, ipHdr)
+}